@@ -0,0 +1,8 @@
+package pwalk
+
+// fileKey uniquely identifies a directory on disk, independent of the
+// path used to reach it, so that following symlinks can detect a cycle.
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
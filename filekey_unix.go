@@ -0,0 +1,20 @@
+//go:build !windows
+
+package pwalk
+
+import (
+	"os"
+	"syscall"
+)
+
+// dirKey returns the (device, inode) pair identifying info's underlying
+// directory. It reports false if the platform-specific stat info isn't
+// available, in which case the caller cannot detect cycles through the
+// entry.
+func dirKey(path string, info os.FileInfo) (fileKey, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(st.Dev), ino: st.Ino}, true
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package pwalk
+
+import (
+	"os"
+	"syscall"
+)
+
+// dirKey returns a (volume serial, file index) pair identifying the
+// directory at path, obtained via GetFileInformationByHandle since
+// os.FileInfo.Sys() doesn't carry a stable identifier on Windows. It
+// reports false if the directory couldn't be opened.
+func dirKey(path string, info os.FileInfo) (fileKey, bool) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return fileKey{}, false
+	}
+	h, err := syscall.CreateFile(p,
+		syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING,
+		syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return fileKey{}, false
+	}
+	defer syscall.CloseHandle(h)
+
+	var fi syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &fi); err != nil {
+		return fileKey{}, false
+	}
+	return fileKey{
+		dev: uint64(fi.VolumeSerialNumber),
+		ino: uint64(fi.FileIndexHigh)<<32 | uint64(fi.FileIndexLow),
+	}, true
+}
@@ -0,0 +1,138 @@
+package pwalk_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	walk "github.com/glycerine/parallelwalk"
+)
+
+func TestWalkOptionsFollowSymlinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "pwalk-symlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// The link's target lies outside root, so the walk reaches it only
+	// through the link: a target the walk has already entered directly
+	// is reported as ErrSymlinkLoop instead of being descended into.
+	real, err := ioutil.TempDir("", "pwalk-symlink-target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(real)
+	touch(t, walk.Join(real, "file"))
+
+	link := walk.Join(root, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks unsupported here: %v", err)
+	}
+
+	var seenFile bool
+	var mu sync.Mutex
+	err = walk.WalkOptions(root, walk.WalkOpts{FollowSymlinks: true}, func(path string, info os.FileInfo, hassub bool, err error) error {
+		if err != nil {
+			t.Errorf("unexpected error at %s: %v", path, err)
+			return nil
+		}
+		mu.Lock()
+		if path == walk.Join(link, "file") {
+			seenFile = true
+		}
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkOptions error: %v", err)
+	}
+	if !seenFile {
+		t.Fatalf("did not descend through symlink %s", link)
+	}
+}
+
+func TestWalkOptionsSymlinkLoop(t *testing.T) {
+	root, err := ioutil.TempDir("", "pwalk-symlink-loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	loop := walk.Join(root, "loop")
+	if err := os.Symlink(root, loop); err != nil {
+		t.Skipf("symlinks unsupported here: %v", err)
+	}
+
+	var mu sync.Mutex
+	var sawLoopErr bool
+	err = walk.WalkOptions(root, walk.WalkOpts{FollowSymlinks: true}, func(path string, info os.FileInfo, hassub bool, err error) error {
+		mu.Lock()
+		if err == walk.ErrSymlinkLoop {
+			sawLoopErr = true
+		}
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkOptions error: %v", err)
+	}
+	if !sawLoopErr {
+		t.Fatalf("expected ErrSymlinkLoop for %s", loop)
+	}
+}
+
+// TestWalkOptionsSymlinkLoopToAncestor covers a symlink pointing back at
+// a non-root ancestor directory (root/A/B/link -> root/A). Without
+// registering an ordinary directory's key as soon as it is entered
+// normally, the loop isn't recognized until the *second* time A's
+// subtree is reached, so every file under A gets delivered to fn twice.
+func TestWalkOptionsSymlinkLoopToAncestor(t *testing.T) {
+	root, err := ioutil.TempDir("", "pwalk-symlink-ancestor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	a := walk.Join(root, "A")
+	b := walk.Join(a, "B")
+	if err := os.MkdirAll(b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, walk.Join(a, "file"))
+
+	link := walk.Join(b, "link")
+	if err := os.Symlink(a, link); err != nil {
+		t.Skipf("symlinks unsupported here: %v", err)
+	}
+
+	var mu sync.Mutex
+	visits := map[string]int{}
+	var sawLoopErr bool
+	err = walk.WalkOptions(root, walk.WalkOpts{FollowSymlinks: true}, func(path string, info os.FileInfo, hassub bool, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err == walk.ErrSymlinkLoop {
+			sawLoopErr = true
+			return nil
+		}
+		visits[path]++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkOptions error: %v", err)
+	}
+	if !sawLoopErr {
+		t.Fatalf("expected ErrSymlinkLoop for %s", link)
+	}
+	if n := visits[walk.Join(a, "file")]; n != 1 {
+		t.Fatalf("%s visited %d times; want 1", walk.Join(a, "file"), n)
+	}
+	if n := visits[a]; n != 1 {
+		t.Fatalf("%s visited %d times; want 1", a, n)
+	}
+	if n := visits[walk.Join(link, "file")]; n != 0 {
+		t.Fatalf("%s visited %d times; want 0", walk.Join(link, "file"), n)
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pwalk implements a parallel version of filepath.Walk: the
+// supplied WalkFunc is invoked concurrently, one goroutine per
+// subdirectory, rather than serially depth-first as in the standard
+// library. On large trees with many independent subdirectories (source
+// trees, package caches, media archives, ...) this gives a considerable
+// speedup on SSDs and networked filesystems, at the cost of requiring
+// WalkFunc to be safe for concurrent use.
+package pwalk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SkipDir is used as a return value from WalkFuncs to indicate that
+// the directory named in the call is to be skipped. It is not returned
+// as an error by any function.
+var SkipDir = filepath.SkipDir
+
+// ErrSymlinkLoop is passed to WalkFunc, in place of a directory read
+// error, when WalkOpts.FollowSymlinks has led back to a directory
+// already visited earlier in the same walk.
+var ErrSymlinkLoop = errors.New("pwalk: symlink loop detected")
+
+// WalkFunc is the type of the function called for each file or directory
+// visited by Walk. The path argument contains the path as passed to
+// Walk; it is relative to root if root itself was relative. The info
+// argument is the os.FileInfo for path, as returned by Lstat (or, for a
+// symlink followed under WalkOpts.FollowSymlinks, by Stat of its
+// target), and may be nil if an error prevented it from being obtained.
+// hassub reports whether path is a directory (and therefore may itself
+// contain entries that Walk will visit). err is non-nil if Walk failed
+// to read path or one of its entries; returning SkipDir from a
+// directory's WalkFunc causes Walk to skip that directory's contents,
+// and returning any other non-nil error also keeps Walk out of that
+// directory's contents and is propagated back out of Walk (the first
+// such error, if several). Entries elsewhere in the tree are still
+// visited. The return value is ignored for the calls that report a
+// broken symlink or ErrSymlinkLoop.
+//
+// Because the parallel workers invoke WalkFunc concurrently for
+// different subtrees, implementations must synchronize any shared state
+// they touch.
+type WalkFunc func(path string, info os.FileInfo, hassub bool, err error) error
+
+// WalkOpts configures the behavior of a parallel walk. The zero value,
+// DefaultOpts, matches the behavior of Walk: no symlink following, and
+// no limit on the number of goroutines or open directories a walk may
+// use at once.
+type WalkOpts struct {
+	// FollowSymlinks, if true, descends into directories reached
+	// through a symbolic link instead of treating them as opaque
+	// leaf entries. Directories are identified by device and inode
+	// (or the platform equivalent) as they are followed, so a cycle
+	// introduced by a symlink is reported to WalkFunc as
+	// ErrSymlinkLoop instead of being walked forever.
+	FollowSymlinks bool
+
+	// MaxWorkers caps the number of directories processed at once.
+	// Zero means unlimited: a goroutine is spawned for every
+	// subdirectory, as Walk has always done. Set this on deep or
+	// very wide trees to avoid exhausting file descriptors or
+	// goroutine/memory limits.
+	MaxWorkers int
+
+	// MaxOpenDirs caps the number of directories that may be open
+	// for reading at once, independent of MaxWorkers (a worker
+	// spends only part of its time with a directory open). Zero
+	// means unlimited. Lower this to tune for spinning disks, where
+	// too much read concurrency hurts rather than helps; raise
+	// MaxWorkers instead for NVMe-class storage.
+	MaxOpenDirs int
+
+	// BufferSize sets the capacity of the channel workers use to hand
+	// newly discovered subdirectories back into the queue, used only
+	// when MaxWorkers > 0. It defaults to MaxWorkers if left at zero.
+	// An internal relay absorbs any backlog beyond this capacity
+	// without blocking a worker indefinitely, so BufferSize only
+	// tunes how far a worker may get ahead of that relay before
+	// blocking momentarily; it has no effect on correctness.
+	BufferSize int
+
+	// Sorted, if true, restores the per-directory lexical ordering
+	// filepath.Walk guarantees: fn is invoked for a directory's
+	// immediate entries in name order, even though the subtrees
+	// beneath those entries still proceed in parallel with one
+	// another. Sorted has no effect when MaxWorkers is set; pooled
+	// walks remain unordered.
+	Sorted bool
+
+	// Filter, if non-nil, is called with a directory's path and the
+	// raw name of each of its entries before that entry is even
+	// Lstat'd. Returning false prunes the entry: it is never stat'd,
+	// never passed to fn, and, if it would have been a directory,
+	// its descendants are never read or visited either. Use Filter
+	// to cheaply skip entries like ".git" or "node_modules" without
+	// paying for a stat or a goroutine per file underneath them.
+	Filter func(parent, name string) bool
+}
+
+// DefaultOpts is the WalkOpts used by Walk.
+var DefaultOpts = WalkOpts{}
+
+// lstatFunc is the implementation used internally to stat each entry.
+// LstatP exposes a pointer to it so tests can inject stat failures.
+var lstatFunc = os.Lstat
+
+// LstatP points at the lstat implementation Walk uses internally.
+// It is exported only so that tests can substitute a faulty
+// implementation; production code should not need to touch it.
+var LstatP = &lstatFunc
+
+// Join joins any number of path elements into a single path, exactly as
+// filepath.Join does. It is re-exported here so callers need only import
+// this package when working with Walk paths.
+func Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+// Rel is filepath.Rel, re-exported for callers' convenience.
+func Rel(basepath, targpath string) (string, error) {
+	return filepath.Rel(basepath, targpath)
+}
+
+// ToSlash is filepath.ToSlash, re-exported for callers' convenience.
+func ToSlash(path string) string {
+	return filepath.ToSlash(path)
+}
+
+// EvalSymlinks is filepath.EvalSymlinks, re-exported for callers'
+// convenience.
+func EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+// Walk walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root itself. Unlike filepath.Walk,
+// the subtrees of root are walked in parallel: fn is called from
+// multiple goroutines at once, one per directory, so fn must be safe for
+// concurrent use. Walk does not follow symbolic links; use WalkOptions
+// or WalkContext with WalkOpts.FollowSymlinks to do so. Walk is a thin
+// wrapper around WalkContext(context.Background(), root, DefaultOpts, fn).
+func Walk(root string, fn WalkFunc) error {
+	return WalkContext(context.Background(), root, DefaultOpts, fn)
+}
+
+// WalkOptions is Walk with explicit WalkOpts, and no way to cancel the
+// walk in progress. It is a thin wrapper around
+// WalkContext(context.Background(), root, opts, fn).
+func WalkOptions(root string, opts WalkOpts, fn WalkFunc) error {
+	return WalkContext(context.Background(), root, opts, fn)
+}
+
+// WalkContext is Walk with explicit WalkOpts and cancellation. Workers
+// check ctx between reading a directory's entries and invoking fn on
+// it, and return ctx.Err() promptly instead of continuing the walk.
+func WalkContext(ctx context.Context, root string, opts WalkOpts, fn WalkFunc) error {
+	info, err := (*LstatP)(root)
+	if err != nil {
+		return fn(root, nil, false, err)
+	}
+
+	var visited *sync.Map
+	if opts.FollowSymlinks {
+		visited = new(sync.Map)
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, terr := resolveSymlink(root)
+			if terr != nil {
+				return fn(root, info, false, terr)
+			}
+			info = target
+		}
+		if key, ok := dirKey(root, info); ok {
+			visited.Store(key, struct{}{})
+		}
+	}
+
+	var ioSem chan struct{}
+	if opts.MaxOpenDirs > 0 {
+		ioSem = make(chan struct{}, opts.MaxOpenDirs)
+	}
+
+	if opts.MaxWorkers <= 0 {
+		if opts.Sorted {
+			return walkSorted(ctx, root, info, opts, visited, ioSem, fn)
+		}
+		return walk(ctx, root, info, opts, visited, ioSem, fn)
+	}
+	return walkPooled(ctx, root, info, opts, visited, ioSem, fn)
+}
+
+// resolveSymlink follows the symlink at path and stats what it points
+// at, returning the target's os.FileInfo.
+func resolveSymlink(path string) (os.FileInfo, error) {
+	resolved, err := EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(resolved)
+}
+
+// resolveEntry decides what Walk should do with a directory entry
+// already Lstat'd as fi. If fi needs no special handling (the common
+// case: a plain file, or any entry when FollowSymlinks is off), it
+// returns filename, fi, true and the caller should keep processing it
+// as usual. If fi is an ordinary (non-symlink) directory and
+// FollowSymlinks is on, its key is registered in visited before it is
+// returned, so that a symlink reached later which points back at it is
+// recognized as a cycle on first encounter rather than after the
+// subtree has already been walked once in full. If fi is a symlink and
+// FollowSymlinks is on, resolveEntry follows it and either returns the
+// symlink's own path, with its target's info, for the caller to
+// continue with (true), or, for a
+// broken symlink or one that closes a cycle, reports the terminal
+// result to fn itself and returns ok=false.
+func resolveEntry(visited *sync.Map, fn WalkFunc, filename string, fi os.FileInfo) (path string, info os.FileInfo, ok bool) {
+	if visited == nil {
+		return filename, fi, true
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		if fi.IsDir() {
+			if key, ok := dirKey(filename, fi); ok {
+				visited.Store(key, struct{}{})
+			}
+		}
+		return filename, fi, true
+	}
+	target, terr := resolveSymlink(filename)
+	if terr != nil {
+		fn(filename, fi, false, terr)
+		return "", nil, false
+	}
+	if target.IsDir() {
+		if key, ok := dirKey(filename, target); ok {
+			if _, loop := visited.LoadOrStore(key, struct{}{}); loop {
+				fn(filename, target, true, ErrSymlinkLoop)
+				return "", nil, false
+			}
+		}
+	}
+	return filename, target, true
+}
+
+// ctxDone reports whether ctx has already been canceled.
+func ctxDone(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// walk recursively descends path, which has already been resolved to
+// info (following opts.FollowSymlinks if path is itself a symlink),
+// spawning one goroutine per subdirectory with no bound on how many run
+// at once. visited is nil unless opts.FollowSymlinks is set.
+func walk(ctx context.Context, path string, info os.FileInfo, opts WalkOpts, visited *sync.Map, ioSem chan struct{}, fn WalkFunc) error {
+	if ctxDone(ctx) {
+		return ctx.Err()
+	}
+
+	hassub := info.IsDir()
+	if !hassub {
+		return fn(path, info, false, nil)
+	}
+
+	names, rerr := readDirNames(ioSem, path)
+	if ctxDone(ctx) {
+		return ctx.Err()
+	}
+	ferr := fn(path, info, true, rerr)
+	if rerr != nil || ferr != nil {
+		if ferr == SkipDir {
+			return nil
+		}
+		return ferr
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	descend := func(filename string, fi os.FileInfo) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record(walk(ctx, filename, fi, opts, visited, ioSem, fn))
+		}()
+	}
+
+	for _, name := range names {
+		if opts.Filter != nil && !opts.Filter(path, name) {
+			continue
+		}
+		filename := filepath.Join(path, name)
+		fi, lerr := (*LstatP)(filename)
+		if lerr != nil {
+			record(fn(filename, fi, false, lerr))
+			continue
+		}
+
+		rpath, rinfo, ok := resolveEntry(visited, fn, filename, fi)
+		if !ok {
+			continue
+		}
+		if rinfo.IsDir() {
+			descend(rpath, rinfo)
+		} else {
+			record(walk(ctx, rpath, rinfo, opts, visited, ioSem, fn))
+		}
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// readDirNames returns the names of the entries in dirname, unsorted
+// (in whatever order the underlying filesystem returns them). If ioSem
+// is non-nil, opening dirname first acquires a slot from it, bounding
+// how many directories may be open for reading at once.
+func readDirNames(ioSem chan struct{}, dirname string) ([]string, error) {
+	if ioSem != nil {
+		ioSem <- struct{}{}
+		defer func() { <-ioSem }()
+	}
+	f, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,44 @@
+package pwalk_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	walk "github.com/glycerine/parallelwalk"
+)
+
+func TestWalkContextCanceled(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := walk.WalkContext(ctx, tree.name, walk.DefaultOpts, func(path string, info os.FileInfo, hassub bool, err error) error {
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWalkContextMaxWorkers(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	opts := walk.WalkOpts{MaxWorkers: 2, MaxOpenDirs: 2, BufferSize: 4}
+	errs := make([]error, 0, 10)
+	err := walk.WalkContext(context.Background(), tree.name, opts, func(path string, info os.FileInfo, hassub bool, err error) error {
+		return mark(path, info, err, &errs, true)
+	})
+	if err != nil {
+		t.Fatalf("no error expected, found: %s", err)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %s", errs)
+	}
+	checkMarks(t, true)
+}
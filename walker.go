@@ -0,0 +1,163 @@
+package pwalk
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// defaultWalkerBuffer bounds how far the producer side of a Walker may
+// run ahead of a consumer that calls Step slowly (or not at all for a
+// while): once it fills, the parallel workers feeding it block on
+// send instead of piling up an unbounded number of pending entries.
+const defaultWalkerBuffer = 64
+
+// errWalkerClosed is returned from the Walker's internal WalkFunc once
+// Close has been called, so that every in-flight branch of the
+// underlying walk unwinds instead of blocking forever trying to hand
+// off an entry nobody will ever read.
+var errWalkerClosed = errors.New("pwalk: walker closed")
+
+// walkItem is one entry handed from the parallel workers to a Walker.
+// proceed is non-nil only for directories: the worker that produced the
+// entry blocks on it before deciding whether to descend, so SkipDir can
+// reach back into the still-running parallel walk.
+type walkItem struct {
+	path    string
+	info    os.FileInfo
+	hassub  bool
+	err     error
+	proceed chan bool
+	once    sync.Once
+}
+
+func (it *walkItem) resolve(skip bool) {
+	if it.proceed == nil {
+		return
+	}
+	it.once.Do(func() { it.proceed <- skip })
+}
+
+// Walker provides pull-based iteration over a parallel Walk, for callers
+// who would rather write a loop than a goroutine-safe WalkFunc, as with
+// github.com/kr/fs. NewWalker starts the underlying parallel traversal
+// immediately in the background; Step, Path, Stat, Err and SkipDir then
+// drive it one entry at a time from the caller's goroutine.
+//
+// Call Close if the Walker is abandoned before Step returns false (for
+// example, once the caller has found what it was looking for) so the
+// background goroutine isn't left blocked handing off an entry nobody
+// will read.
+type Walker struct {
+	items     chan *walkItem
+	cur       *walkItem
+	err       error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWalker starts a parallel walk of root and returns a Walker over its
+// results. It is named NewWalker, rather than Walk, because this
+// package's Walk already denotes the callback-based entry point.
+func NewWalker(root string) *Walker {
+	w := &Walker{
+		items: make(chan *walkItem, defaultWalkerBuffer),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(w.items)
+		w.err = Walk(root, func(path string, info os.FileInfo, hassub bool, err error) error {
+			it := &walkItem{path: path, info: info, hassub: hassub, err: err}
+			if hassub {
+				it.proceed = make(chan bool, 1)
+			}
+			select {
+			case w.items <- it:
+			case <-w.done:
+				return errWalkerClosed
+			}
+			if it.proceed == nil {
+				return nil
+			}
+			select {
+			case skip := <-it.proceed:
+				if skip {
+					return SkipDir
+				}
+				return nil
+			case <-w.done:
+				return errWalkerClosed
+			}
+		})
+	}()
+	return w
+}
+
+// Close stops the underlying walk and waits for its background
+// goroutine to exit. It is safe to call more than once, and safe to
+// call after Step has already returned false (in which case it is a
+// no-op). Any caller that stops calling Step before it returns false
+// must call Close.
+func (w *Walker) Close() {
+	w.closeOnce.Do(func() { close(w.done) })
+	for range w.items {
+	}
+}
+
+// Step advances to the next entry and reports whether one was found. It
+// must be called before the first call to Path, Stat or Err. Stepping
+// past a directory entry without calling SkipDir lets the walk descend
+// into it.
+func (w *Walker) Step() bool {
+	if w.cur != nil {
+		w.cur.resolve(false)
+	}
+	it, ok := <-w.items
+	if !ok {
+		w.cur = nil
+		return false
+	}
+	w.cur = it
+	return true
+}
+
+// Path returns the path of the most recent entry visited by Step.
+func (w *Walker) Path() string {
+	if w.cur == nil {
+		return ""
+	}
+	return w.cur.path
+}
+
+// Stat returns the os.FileInfo of the most recent entry visited by
+// Step. It may be nil if Err is non-nil.
+func (w *Walker) Stat() os.FileInfo {
+	if w.cur == nil {
+		return nil
+	}
+	return w.cur.info
+}
+
+// Err returns the error, if any, associated with the most recent entry
+// visited by Step. Once Step returns false, Err instead returns the
+// terminal error (if any) of the underlying Walk; this is nil after a
+// Close of a Walker that hadn't already finished on its own.
+func (w *Walker) Err() error {
+	if w.cur != nil {
+		return w.cur.err
+	}
+	if w.err == errWalkerClosed {
+		return nil
+	}
+	return w.err
+}
+
+// SkipDir tells the walk to skip the directory named by the most recent
+// call to Step, the same way returning SkipDir from a WalkFunc does. It
+// has no effect if the current entry is not a directory or has already
+// been resolved.
+func (w *Walker) SkipDir() {
+	if w.cur != nil {
+		w.cur.resolve(true)
+	}
+}
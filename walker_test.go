@@ -0,0 +1,68 @@
+package pwalk_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	walk "github.com/glycerine/parallelwalk"
+)
+
+func TestWalker(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	w := walk.NewWalker(tree.name)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			t.Fatalf("unexpected error at %s: %v", w.Path(), err)
+		}
+		mark(w.Path(), w.Stat(), nil, &[]error{}, true)
+	}
+	checkMarks(t, true)
+}
+
+func TestWalkerSkipDir(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	dPath := walk.Join(tree.name, "d")
+	seenUnderD := false
+	w := walk.NewWalker(tree.name)
+	for w.Step() {
+		if w.Path() == dPath {
+			w.SkipDir()
+			continue
+		}
+		if len(w.Path()) > len(dPath) && w.Path()[:len(dPath)+1] == dPath+string(os.PathSeparator) {
+			seenUnderD = true
+		}
+	}
+	if seenUnderD {
+		t.Fatalf("SkipDir did not prune %s", dPath)
+	}
+}
+
+func TestWalkerClose(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	w := walk.NewWalker(tree.name)
+	if !w.Step() {
+		t.Fatalf("expected at least one entry")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		w.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return; background goroutine leaked")
+	}
+}
@@ -0,0 +1,43 @@
+package pwalk_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	walk "github.com/glycerine/parallelwalk"
+)
+
+func TestWalkOptionsFilter(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	var mu sync.Mutex
+	var sawD, statdD bool
+	opts := walk.WalkOpts{
+		Filter: func(parent, name string) bool {
+			return name != "d"
+		},
+	}
+	err := walk.WalkOptions(tree.name, opts, func(path string, info os.FileInfo, hassub bool, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if path == walk.Join(tree.name, "d") {
+			sawD = true
+		}
+		if info != nil && (info.Name() == "x" || info.Name() == "u") {
+			statdD = true
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("no error expected, found: %s", err)
+	}
+	if sawD {
+		t.Fatalf("Filter did not prune %q itself", "d")
+	}
+	if statdD {
+		t.Fatalf("Filter did not prune %q's descendants", "d")
+	}
+}
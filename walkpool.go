@@ -0,0 +1,174 @@
+package pwalk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// dirTask is one directory awaiting a worker in walkPooled.
+type dirTask struct {
+	path string
+	info os.FileInfo
+}
+
+// walkPooled is WalkContext's implementation when opts.MaxWorkers > 0:
+// a fixed pool of opts.MaxWorkers goroutines drains a queue of
+// directories instead of spawning one goroutine per subdirectory.
+// Workers feed newly discovered subdirectories back onto the same
+// queue, so the walk finishes once no directory remains pending.
+//
+// A worker enqueuing a subdirectory it just found is itself a consumer
+// of that same queue, so the hand-off goes through unboundedQueue
+// rather than a plain bounded channel: if every worker discovers new
+// subdirectories at once, none of them can be left blocked waiting for
+// a sibling to come back and receive, because no sibling ever will (it
+// is blocked doing the exact same thing). unboundedQueue's relay
+// goroutine is always ready to accept a send, so a worker handing off
+// a subdirectory is never at the mercy of the other workers' progress.
+func walkPooled(ctx context.Context, root string, rootInfo os.FileInfo, opts WalkOpts, visited *sync.Map, ioSem chan struct{}, fn WalkFunc) error {
+	if !rootInfo.IsDir() {
+		if ctxDone(ctx) {
+			return ctx.Err()
+		}
+		return fn(root, rootInfo, false, nil)
+	}
+
+	bufSize := opts.BufferSize
+	if bufSize <= 0 {
+		bufSize = opts.MaxWorkers
+	}
+	in := make(chan dirTask, bufSize)
+	tasks := unboundedQueue(in)
+
+	var (
+		pending  sync.WaitGroup // directories discovered but not yet fully processed
+		mu       sync.Mutex
+		firstErr error
+	)
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < opts.MaxWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for task := range tasks {
+				processDir(ctx, task.path, task.info, opts, visited, ioSem, fn, in, &pending, record)
+			}
+		}()
+	}
+
+	pending.Add(1)
+	in <- dirTask{root, rootInfo}
+
+	go func() {
+		pending.Wait()
+		close(in)
+	}()
+	workers.Wait()
+	return firstErr
+}
+
+// processDir reads one directory's entries, reports them through fn,
+// and enqueues any subdirectories it finds back onto in for a (not
+// necessarily the same) worker to pick up.
+func processDir(ctx context.Context, path string, info os.FileInfo, opts WalkOpts, visited *sync.Map, ioSem chan struct{}, fn WalkFunc, in chan<- dirTask, pending *sync.WaitGroup, record func(error)) {
+	defer pending.Done()
+
+	if ctxDone(ctx) {
+		record(ctx.Err())
+		return
+	}
+
+	names, rerr := readDirNames(ioSem, path)
+	if ctxDone(ctx) {
+		record(ctx.Err())
+		return
+	}
+	ferr := fn(path, info, true, rerr)
+	if rerr != nil || ferr != nil {
+		if ferr != SkipDir {
+			record(ferr)
+		}
+		return
+	}
+
+	for _, name := range names {
+		if opts.Filter != nil && !opts.Filter(path, name) {
+			continue
+		}
+		filename := filepath.Join(path, name)
+		fi, lerr := (*LstatP)(filename)
+		if lerr != nil {
+			record(fn(filename, fi, false, lerr))
+			continue
+		}
+
+		rpath, rinfo, ok := resolveEntry(visited, fn, filename, fi)
+		if !ok {
+			continue
+		}
+		if rinfo.IsDir() {
+			pending.Add(1)
+			in <- dirTask{rpath, rinfo}
+			continue
+		}
+		if ctxDone(ctx) {
+			record(ctx.Err())
+			continue
+		}
+		record(fn(rpath, rinfo, false, nil))
+	}
+}
+
+// unboundedQueue relays dirTasks from in to the returned channel
+// without ever leaving a sender on in blocked indefinitely, buffering
+// internally in a growable slice as needed. Its goroutine is always
+// either waiting to receive from in, or selecting between a receive
+// from in and a send to the output, so a send on in only ever waits on
+// this one always-available goroutine rather than on whichever
+// consumer happens to be free.
+//
+// The returned channel is closed once in is closed and every buffered
+// task has been delivered.
+func unboundedQueue(in <-chan dirTask) <-chan dirTask {
+	out := make(chan dirTask)
+	go func() {
+		defer close(out)
+		var pending []dirTask
+		open := true
+		for open || len(pending) > 0 {
+			if len(pending) == 0 {
+				task, ok := <-in
+				if !ok {
+					open = false
+					continue
+				}
+				pending = append(pending, task)
+				continue
+			}
+			select {
+			case task, ok := <-in:
+				if !ok {
+					open = false
+					continue
+				}
+				pending = append(pending, task)
+			case out <- pending[0]:
+				pending = pending[1:]
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,81 @@
+package pwalk_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	walk "github.com/glycerine/parallelwalk"
+)
+
+// makeWideTree builds a tree rooted at dir with the given depth, where
+// every directory at every level but the last has fanWidth
+// subdirectories and no files, and every directory at the last level
+// holds one file and no subdirectories. It is meant to give several
+// workers a chance to discover several subdirectories each at the same
+// time, which a flat, single-level fan-out does not.
+func makeWideTree(t *testing.T, dir string, depth, fanWidth int) {
+	t.Helper()
+	if depth == 0 {
+		touch(t, walk.Join(dir, "file"))
+		return
+	}
+	for i := 0; i < fanWidth; i++ {
+		sub := walk.Join(dir, fmt.Sprintf("d%d", i))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		makeWideTree(t, sub, depth-1, fanWidth)
+	}
+}
+
+// TestWalkPooledDefaultBufferSize exercises walkPooled with MaxWorkers
+// set and BufferSize left at its default (equal to MaxWorkers), against
+// a tree whose fan-out at every level exceeds MaxWorkers. Each worker
+// discovering more subdirectories than the whole pool has capacity for
+// used to deadlock every worker trying to hand its finds back onto a
+// full, bounded channel with nobody left to drain it; this must
+// complete well within the timeout instead of hanging.
+func TestWalkPooledDefaultBufferSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "pwalk-pool-wide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	makeWideTree(t, root, 3, 3)
+
+	opts := walk.WalkOpts{MaxWorkers: 2}
+	var mu sync.Mutex
+	visited := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- walk.WalkContext(context.Background(), root, opts, func(path string, info os.FileInfo, hassub bool, err error) error {
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			visited++
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WalkContext error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WalkContext with MaxWorkers set and default BufferSize did not return; deadlocked")
+	}
+
+	// root itself, plus 3+9+27 directories, plus 27 files.
+	want := 1 + 3 + 9 + 27 + 27
+	if visited != want {
+		t.Fatalf("visited %d entries; want %d", visited, want)
+	}
+}
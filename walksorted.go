@@ -0,0 +1,108 @@
+package pwalk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// walkSorted is WalkContext's implementation when opts.Sorted is set:
+// fn is invoked for the immediate children of any one directory in
+// lexical name order, while the subtrees beneath those children still
+// proceed in parallel with each other.
+func walkSorted(ctx context.Context, root string, info os.FileInfo, opts WalkOpts, visited *sync.Map, ioSem chan struct{}, fn WalkFunc) error {
+	if ctxDone(ctx) {
+		return ctx.Err()
+	}
+	if !info.IsDir() {
+		return fn(root, info, false, nil)
+	}
+
+	names, rerr := readDirNames(ioSem, root)
+	if ctxDone(ctx) {
+		return ctx.Err()
+	}
+	sort.Strings(names)
+	ferr := fn(root, info, true, rerr)
+	if rerr != nil || ferr != nil {
+		if ferr == SkipDir {
+			return nil
+		}
+		return ferr
+	}
+	return walkSortedChildren(ctx, root, names, opts, visited, ioSem, fn)
+}
+
+// walkSortedChildren visits dir's already-read, already-sorted entries
+// in order. For a subdirectory it reads and announces that
+// subdirectory itself before moving on to the next sibling, holding the
+// ordering guarantee, then hands the now-known grandchildren off to a
+// goroutine so that the subtrees of different siblings still overlap.
+func walkSortedChildren(ctx context.Context, dir string, names []string, opts WalkOpts, visited *sync.Map, ioSem chan struct{}, fn WalkFunc) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+
+	for _, name := range names {
+		if ctxDone(ctx) {
+			record(ctx.Err())
+			break
+		}
+
+		if opts.Filter != nil && !opts.Filter(dir, name) {
+			continue
+		}
+
+		filename := filepath.Join(dir, name)
+		fi, lerr := (*LstatP)(filename)
+		if lerr != nil {
+			record(fn(filename, fi, false, lerr))
+			continue
+		}
+
+		rpath, rinfo, ok := resolveEntry(visited, fn, filename, fi)
+		if !ok {
+			continue
+		}
+		if !rinfo.IsDir() {
+			record(fn(rpath, rinfo, false, nil))
+			continue
+		}
+
+		childNames, rerr := readDirNames(ioSem, rpath)
+		if ctxDone(ctx) {
+			record(ctx.Err())
+			break
+		}
+		sort.Strings(childNames)
+		ferr := fn(rpath, rinfo, true, rerr)
+		if rerr != nil || ferr != nil {
+			if ferr != SkipDir {
+				record(ferr)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(rpath string, childNames []string) {
+			defer wg.Done()
+			record(walkSortedChildren(ctx, rpath, childNames, opts, visited, ioSem, fn))
+		}(rpath, childNames)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,42 @@
+package pwalk_test
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	walk "github.com/glycerine/parallelwalk"
+)
+
+func TestWalkContextSorted(t *testing.T) {
+	os.RemoveAll(tree.name)
+	makeTree(t)
+	defer os.RemoveAll(tree.name)
+
+	var mu sync.Mutex
+	var order []string
+	opts := walk.WalkOpts{Sorted: true}
+	err := walk.WalkOptions(tree.name, opts, func(path string, info os.FileInfo, hassub bool, err error) error {
+		rel, rerr := walk.Rel(tree.name, path)
+		if rerr != nil || rel == "." || strings.Contains(walk.ToSlash(rel), "/") {
+			return err
+		}
+		mu.Lock()
+		order = append(order, rel)
+		mu.Unlock()
+		return err
+	})
+	if err != nil {
+		t.Fatalf("no error expected, found: %s", err)
+	}
+	want := []string{"a", "b", "c", "d"}
+	if len(order) != len(want) {
+		t.Fatalf("top-level entries = %v; want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("top-level entries = %v; want %v", order, want)
+		}
+	}
+}